@@ -0,0 +1,158 @@
+package ebpf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cilium/ebpf/internal/platform"
+)
+
+// cpuCache caches the parsed CPU topology behind a mutex rather than a
+// sync.Once, so that testCPURange can reset it for the next test instead
+// of permanently disabling the real procfs-parsing path for the rest of
+// the process.
+var cpuCache struct {
+	mu sync.Mutex
+
+	possibleParsed bool
+	possible       int
+	possibleErr    error
+
+	onlineParsed bool
+	online       []int
+	onlineErr    error
+}
+
+// PossibleCPUs returns the number of CPUs a system can possibly have, that
+// is, the size the kernel allocates per-CPU map values for.
+//
+// The result is parsed once from /sys/devices/system/cpu/possible and
+// cached, so repeatedly creating per-CPU maps doesn't re-read procfs on
+// every call.
+func PossibleCPUs() (int, error) {
+	cpuCache.mu.Lock()
+	defer cpuCache.mu.Unlock()
+
+	if !cpuCache.possibleParsed {
+		if platform.IsWindows {
+			cpuCache.possible = runtime.NumCPU()
+		} else {
+			cpuCache.possible, cpuCache.possibleErr = parseCPURange("/sys/devices/system/cpu/possible")
+		}
+		cpuCache.possibleParsed = true
+	}
+
+	return cpuCache.possible, cpuCache.possibleErr
+}
+
+// OnlineCPUs returns the IDs of the CPUs that are currently online.
+//
+// The result is parsed once from /sys/devices/system/cpu/online and
+// cached; it won't reflect CPUs brought online or offline afterwards. Use
+// testCPURange (test-only) to override this for CPU-hotplug scenarios.
+func OnlineCPUs() ([]int, error) {
+	cpuCache.mu.Lock()
+	defer cpuCache.mu.Unlock()
+
+	if !cpuCache.onlineParsed {
+		if platform.IsWindows {
+			ids := make([]int, runtime.NumCPU())
+			for i := range ids {
+				ids[i] = i
+			}
+			cpuCache.online = ids
+		} else {
+			cpuCache.online, cpuCache.onlineErr = parseCPUList("/sys/devices/system/cpu/online")
+		}
+		cpuCache.onlineParsed = true
+	}
+
+	return cpuCache.online, cpuCache.onlineErr
+}
+
+// parseCPURange returns the number of CPUs described by the range in path,
+// e.g. "0-3" for 4 CPUs.
+func parseCPURange(path string) (int, error) {
+	ids, err := parseCPUList(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		if id+1 > n {
+			n = id + 1
+		}
+	}
+	return n, nil
+}
+
+// parseCPUList parses a comma-separated list of CPU ids and ranges, such
+// as the contents of /sys/devices/system/cpu/{possible,online}, e.g.
+// "0-2,4".
+func parseCPUList(path string) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("parse cpu list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("parse cpu list %s: %w", path, err)
+	}
+
+	var ids []int
+	for _, part := range strings.Split(strings.TrimSpace(scanner.Text()), ",") {
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "-") {
+			id, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("parse cpu list %s: %w", path, err)
+			}
+			ids = append(ids, id)
+			continue
+		}
+
+		var low, high int
+		if _, err := fmt.Sscanf(part, "%d-%d", &low, &high); err != nil {
+			return nil, fmt.Errorf("parse cpu list %s: %w", path, err)
+		}
+		for id := low; id <= high; id++ {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// testCPURange overrides the cached result of PossibleCPUs and OnlineCPUs
+// for the duration of a test, to simulate CPU-hotplug scenarios without
+// touching procfs. Restore the previous behaviour by calling the returned
+// func, typically via t.Cleanup; afterwards PossibleCPUs/OnlineCPUs go back
+// to parsing procfs (or whatever was cached before) on their next call.
+func testCPURange(possible int, online []int) func() {
+	cpuCache.mu.Lock()
+	prevPossibleParsed, prevPossible, prevPossibleErr := cpuCache.possibleParsed, cpuCache.possible, cpuCache.possibleErr
+	prevOnlineParsed, prevOnline, prevOnlineErr := cpuCache.onlineParsed, cpuCache.online, cpuCache.onlineErr
+
+	cpuCache.possibleParsed, cpuCache.possible, cpuCache.possibleErr = true, possible, nil
+	cpuCache.onlineParsed, cpuCache.online, cpuCache.onlineErr = true, online, nil
+	cpuCache.mu.Unlock()
+
+	return func() {
+		cpuCache.mu.Lock()
+		defer cpuCache.mu.Unlock()
+		cpuCache.possibleParsed, cpuCache.possible, cpuCache.possibleErr = prevPossibleParsed, prevPossible, prevPossibleErr
+		cpuCache.onlineParsed, cpuCache.online, cpuCache.onlineErr = prevOnlineParsed, prevOnline, prevOnlineErr
+	}
+}
@@ -0,0 +1,31 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestCPURangeOverrideAndRestore(t *testing.T) {
+	before, err := PossibleCPUs()
+	qt.Assert(t, qt.IsNil(err))
+
+	restore := testCPURange(64, []int{0, 1, 2, 3})
+
+	got, err := PossibleCPUs()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(got, 64))
+
+	ids, err := OnlineCPUs()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.DeepEquals(ids, []int{0, 1, 2, 3}))
+
+	restore()
+
+	// Restoring puts back whatever the cache held before the override,
+	// here the result of the PossibleCPUs call above, so the override
+	// doesn't leak into later callers.
+	after, err := PossibleCPUs()
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(after, before))
+}
@@ -0,0 +1,131 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strings"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// LoadCollectionSpecFromFS parses the ELF objects in fsys matching pattern
+// into a single CollectionSpec, selecting whichever ones were compiled for
+// the current machine's endianness (*.bpfel.o for little-endian,
+// *.bpfeb.o for big-endian).
+//
+// This lets a binary embed both endian variants of a compiled object and
+// pick the right one at runtime, without invoking bpf2go's code generator
+// or checking in the pair of generated Go files it would otherwise
+// produce:
+//
+//	//go:embed bpf/*.bpfel.o bpf/*.bpfeb.o
+//	var objs embed.FS
+//
+//	spec, err := ebpf.LoadCollectionSpecFromFS(objs, "bpf/*.o")
+//
+// When pattern matches more than one object for the selected endianness,
+// their Maps and Programs are merged into a single CollectionSpec: maps
+// that share a name across objects must agree on type, key and value size,
+// max entries, flags and contents, and are deduplicated, while programs
+// must be unique. This is meant for
+// several independently compiled objects linked into one binary, e.g. a
+// shared library of helpers alongside the programs that call into it.
+func LoadCollectionSpecFromFS(fsys fs.FS, pattern string) (*CollectionSpec, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("glob %q: %w", pattern, err)
+	}
+
+	suffix := nativeObjectSuffix()
+	selected := selectByEndianness(names, suffix)
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no object matching %q compiled for this machine's endianness (%s)", pattern, suffix)
+	}
+
+	var merged *CollectionSpec
+	for _, name := range selected {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+
+		spec, err := LoadCollectionSpecFromReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", name, err)
+		}
+
+		if merged == nil {
+			merged = spec
+			continue
+		}
+		if err := mergeCollectionSpecInto(merged, spec, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+// nativeObjectSuffix returns the filename suffix of the ELF object
+// compiled for this machine's endianness.
+func nativeObjectSuffix() string {
+	if internal.NativeEndian == binary.BigEndian {
+		return ".bpfeb.o"
+	}
+	return ".bpfel.o"
+}
+
+// selectByEndianness filters names down to the ones ending in suffix.
+func selectByEndianness(names []string, suffix string) []string {
+	var selected []string
+	for _, name := range names {
+		if strings.HasSuffix(name, suffix) {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+// mergeCollectionSpecInto merges src's Maps and Programs into dst, in
+// place, as part of assembling the CollectionSpec for several embedded
+// objects matched by the same LoadCollectionSpecFromFS pattern.
+func mergeCollectionSpecInto(dst, src *CollectionSpec, srcName string) error {
+	for name, m := range src.Maps {
+		existing, ok := dst.Maps[name]
+		if !ok {
+			dst.Maps[name] = m
+			continue
+		}
+		if !mapSpecsCompatible(existing, m) {
+			return fmt.Errorf("%s: map %q conflicts with a differently defined map of the same name", srcName, name)
+		}
+	}
+
+	for name, p := range src.Programs {
+		if _, ok := dst.Programs[name]; ok {
+			return fmt.Errorf("%s: program %q is already defined by another matched object", srcName, name)
+		}
+		dst.Programs[name] = p
+	}
+
+	return nil
+}
+
+// mapSpecsCompatible reports whether two MapSpecs describe the same map,
+// for deduplicating a map shared by several compilation units, such as a
+// common .rodata/.bss or an explicitly pinned shared map. Contents is
+// compared too: two .rodata maps with the same name and shape but
+// different constant initializers are a conflict, not a dedup candidate.
+// Other fields, such as Pinning, InnerMap or the Key/Value BTF types, are
+// not compared.
+func mapSpecsCompatible(a, b *MapSpec) bool {
+	return a.Type == b.Type &&
+		a.KeySize == b.KeySize &&
+		a.ValueSize == b.ValueSize &&
+		a.MaxEntries == b.MaxEntries &&
+		a.Flags == b.Flags &&
+		reflect.DeepEqual(a.Contents, b.Contents)
+}
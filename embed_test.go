@@ -0,0 +1,102 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestNativeObjectSuffix(t *testing.T) {
+	suffix := nativeObjectSuffix()
+	if suffix != ".bpfel.o" && suffix != ".bpfeb.o" {
+		t.Fatalf("unexpected native object suffix %q", suffix)
+	}
+}
+
+func TestSelectByEndianness(t *testing.T) {
+	names := []string{
+		"bpf/prog.bpfel.o",
+		"bpf/prog.bpfeb.o",
+		"bpf/prog.bpfel.o.orig",
+		"bpf/README.md",
+	}
+
+	qt.Assert(t, qt.DeepEquals(selectByEndianness(names, ".bpfel.o"), []string{"bpf/prog.bpfel.o"}))
+	qt.Assert(t, qt.DeepEquals(selectByEndianness(names, ".bpfeb.o"), []string{"bpf/prog.bpfeb.o"}))
+	qt.Assert(t, qt.IsNil(selectByEndianness(names, ".bpfhf.o")))
+}
+
+func TestMergeCollectionSpecIntoSharedMap(t *testing.T) {
+	shared := &MapSpec{Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1}
+
+	dst := &CollectionSpec{
+		Maps:     map[string]*MapSpec{"shared": shared},
+		Programs: map[string]*ProgramSpec{"a": {}},
+	}
+	src := &CollectionSpec{
+		Maps:     map[string]*MapSpec{"shared": {Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1}},
+		Programs: map[string]*ProgramSpec{"b": {}},
+	}
+
+	err := mergeCollectionSpecInto(dst, src, "other.bpfel.o")
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.HasLen(dst.Maps, 1))
+	qt.Assert(t, qt.HasLen(dst.Programs, 2))
+
+	// The pre-existing MapSpec is kept rather than replaced by src's copy,
+	// so any Program in dst that already references it stays valid.
+	qt.Assert(t, qt.Equals(dst.Maps["shared"], shared))
+}
+
+func TestMergeCollectionSpecIntoConflictingMap(t *testing.T) {
+	dst := &CollectionSpec{
+		Maps:     map[string]*MapSpec{"shared": {Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1}},
+		Programs: map[string]*ProgramSpec{},
+	}
+	src := &CollectionSpec{
+		// Same name, different MaxEntries: not the same map.
+		Maps:     map[string]*MapSpec{"shared": {Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 2}},
+		Programs: map[string]*ProgramSpec{},
+	}
+
+	err := mergeCollectionSpecInto(dst, src, "other.bpfel.o")
+	qt.Assert(t, qt.IsNotNil(err))
+}
+
+func TestMergeCollectionSpecIntoConflictingContents(t *testing.T) {
+	dst := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			".rodata": {
+				Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1,
+				Contents: []MapKV{{Key: uint32(0), Value: uint32(1)}},
+			},
+		},
+		Programs: map[string]*ProgramSpec{},
+	}
+	src := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			".rodata": {
+				Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1,
+				Contents: []MapKV{{Key: uint32(0), Value: uint32(2)}},
+			},
+		},
+		Programs: map[string]*ProgramSpec{},
+	}
+
+	err := mergeCollectionSpecInto(dst, src, "other.bpfel.o")
+	qt.Assert(t, qt.IsNotNil(err))
+}
+
+func TestMergeCollectionSpecIntoDuplicateProgram(t *testing.T) {
+	dst := &CollectionSpec{
+		Maps:     map[string]*MapSpec{},
+		Programs: map[string]*ProgramSpec{"a": {}},
+	}
+	src := &CollectionSpec{
+		Maps:     map[string]*MapSpec{},
+		Programs: map[string]*ProgramSpec{"a": {}},
+	}
+
+	err := mergeCollectionSpecInto(dst, src, "other.bpfel.o")
+	qt.Assert(t, qt.IsNotNil(err))
+}
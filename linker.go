@@ -0,0 +1,255 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/internal/sys"
+)
+
+// flattenPrograms resolves bpf-to-bpf calls for a set of entrypoints by
+// walking the graph of ProgramSpecs reachable from those entrypoints and
+// appending each referenced subprogram's Instructions to the entrypoint.
+//
+// Mutates progs in place.
+func flattenPrograms(progs map[string]*ProgramSpec, entrypoints []string) {
+	refs := make(map[*ProgramSpec][]string)
+	for _, prog := range progs {
+		for _, ins := range prog.Instructions {
+			if ref := ins.Reference(); ref != "" && ref != ins.Symbol() {
+				refs[prog] = append(refs[prog], ref)
+			}
+		}
+	}
+
+	for _, name := range entrypoints {
+		flattenInstructions(name, progs, refs)
+	}
+}
+
+// flattenInstructions flattens progs[name] by recursively appending the
+// Instructions of every subprogram it references (directly or
+// transitively) that hasn't already been linked in.
+//
+// Returns the names of the subprograms linked into progs[name]. Programs
+// without any references are left untouched and allocate nothing.
+func flattenInstructions(name string, progs map[string]*ProgramSpec, refs map[*ProgramSpec][]string) []string {
+	prog := progs[name]
+	if prog == nil || len(refs[prog]) == 0 {
+		return nil
+	}
+
+	linked := make(map[string]bool)
+	flattenInto(prog, prog, progs, refs, linked)
+
+	names := make([]string, 0, len(linked))
+	for n := range linked {
+		names = append(names, n)
+	}
+	return names
+}
+
+// flattenInto appends to prog the Instructions of every subprogram that from
+// references, directly or transitively, and that isn't in linked yet.
+// Subprograms themselves are not modified.
+func flattenInto(prog, from *ProgramSpec, progs map[string]*ProgramSpec, refs map[*ProgramSpec][]string, linked map[string]bool) {
+	for _, ref := range refs[from] {
+		if linked[ref] {
+			continue
+		}
+
+		subprog := progs[ref]
+		if subprog == nil {
+			// Left unresolved: the loader reports this as
+			// asm.ErrUnsatisfiedProgramReference, which is where
+			// ExternResolver gets a chance to step in.
+			continue
+		}
+		linked[ref] = true
+
+		prog.Instructions = append(prog.Instructions, subprog.Instructions...)
+		flattenInto(prog, subprog, progs, refs, linked)
+	}
+}
+
+// splitSymbols splits insns into the subprograms delimited by their
+// Symbol, keyed by symbol name.
+//
+// The first instruction of insns must carry a Symbol. Returns an error if
+// insns is empty, doesn't start with a Symbol, or contains a duplicate
+// Symbol.
+func splitSymbols(insns asm.Instructions) (map[string]asm.Instructions, error) {
+	if len(insns) == 0 {
+		return nil, errors.New("insns is empty")
+	}
+
+	if insns[0].Symbol() == "" {
+		return nil, errors.New("insns must start with a Symbol")
+	}
+
+	var name string
+	progs := make(map[string]asm.Instructions)
+	for _, ins := range insns {
+		if sym := ins.Symbol(); sym != "" {
+			if _, ok := progs[sym]; ok {
+				return nil, fmt.Errorf("insns contains duplicate symbol %q", sym)
+			}
+			name = sym
+		}
+		progs[name] = append(progs[name], ins)
+	}
+
+	return progs, nil
+}
+
+// CollectionOptions control how a CollectionSpec's Maps and Programs are
+// loaded into the kernel.
+type CollectionOptions struct {
+	// ExternResolver satisfies forward declarations of extern functions
+	// and variables that the static linker in flattenPrograms couldn't
+	// resolve from within the Collection's own ProgramSpecs. See
+	// ExternResolver for details.
+	ExternResolver ExternResolver
+}
+
+// ExternResolver satisfies forward declarations of extern functions and
+// variables that flattenPrograms couldn't resolve from the set of
+// ProgramSpecs being linked together. Plug it into CollectionOptions to
+// link in a shared library of helpers, or resolve extern globals against
+// a BTF vmlinux handle, without post-processing generated ELFs.
+//
+// loadProgram calls resolveExterns whenever loading a Program fails with
+// asm.ErrUnsatisfiedProgramReference, so implementations run against the
+// already-flattened Instructions of the Program that triggered the error.
+type ExternResolver interface {
+	// ResolveExternFunc resolves a call to the extern function named name,
+	// declared by caller. Returning ErrExternNotFound makes the resolver
+	// try ResolveExternVar for the same name; if that also returns
+	// ErrExternNotFound, the reference is left unsatisfied, which surfaces
+	// to the caller of Load as asm.ErrUnsatisfiedProgramReference.
+	ResolveExternFunc(name string, caller *ProgramSpec) (asm.Instructions, error)
+
+	// ResolveExternVar resolves a reference to the extern variable named
+	// name, declared by caller, against BTF loaded from the kernel (or
+	// another vmlinux handle).
+	ResolveExternVar(name string, caller *ProgramSpec) (*btf.Var, error)
+}
+
+// ErrExternNotFound is returned by an ExternResolver to indicate that it
+// has no substitute for the requested symbol.
+var ErrExternNotFound = errors.New("extern not found")
+
+// ErrExternResolveCycle is returned when resolving an extern transitively
+// depends on itself, which would otherwise recurse forever.
+var ErrExternResolveCycle = errors.New("extern resolution cycle")
+
+// resolveExterns repeatedly asks resolver to satisfy any symbol referenced
+// by spec.Instructions that isn't defined anywhere in spec itself, linking
+// the result in and recursing into it, since a resolved subprog can itself
+// reference further externs.
+func resolveExterns(spec *ProgramSpec, resolver ExternResolver) error {
+	if resolver == nil {
+		return nil
+	}
+	return resolveExternsVisiting(spec, resolver, make(map[string]bool))
+}
+
+func resolveExternsVisiting(spec *ProgramSpec, resolver ExternResolver, visiting map[string]bool) error {
+	defined := make(map[string]bool)
+	for _, ins := range spec.Instructions {
+		if sym := ins.Symbol(); sym != "" {
+			defined[sym] = true
+		}
+	}
+
+	for i := 0; i < len(spec.Instructions); i++ {
+		ref := spec.Instructions[i].Reference()
+		if ref == "" || defined[ref] {
+			continue
+		}
+
+		if visiting[ref] {
+			return fmt.Errorf("resolve extern %q: %w", ref, ErrExternResolveCycle)
+		}
+
+		insns, err := resolver.ResolveExternFunc(ref, spec)
+		if errors.Is(err, ErrExternNotFound) {
+			v, err := resolver.ResolveExternVar(ref, spec)
+			if errors.Is(err, ErrExternNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("resolve extern variable %q: %w", ref, err)
+			}
+
+			spec.Instructions[i].Metadata.Set(externVarMeta{}, v)
+			defined[ref] = true
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("resolve extern function %q: %w", ref, err)
+		}
+
+		// Substituted instructions are appended as returned, keeping
+		// whatever BTF func_info/line_info the resolver attached to them;
+		// the caller's forward reference is left as is and resolves to the
+		// appended Symbol when the Instructions are marshaled.
+		visiting[ref] = true
+		spec.Instructions = append(spec.Instructions, insns...)
+		defined[ref] = true
+
+		if err := resolveExternsVisiting(spec, resolver, visiting); err != nil {
+			return err
+		}
+		delete(visiting, ref)
+	}
+
+	return nil
+}
+
+// externVarMeta tags an instruction with the btf.Var an ExternResolver
+// resolved it against. progLoad does not read this metadata: the
+// instruction is marshaled and loaded unchanged.
+type externVarMeta struct{}
+
+// loadProgram loads spec into the kernel, consulting resolver whenever the
+// load fails because spec.Instructions still contains an unresolved
+// reference, i.e. asm.ErrUnsatisfiedProgramReference. Each round trip
+// through resolver can itself add references that the previous round
+// didn't know about, so the load is retried until it either succeeds, the
+// resolver has nothing left to offer, or resolver reports an error.
+func loadProgram(spec *ProgramSpec, resolver ExternResolver) (*sys.FD, error) {
+	for {
+		fd, err := progLoad(spec.Instructions, spec.Type, spec.License)
+		if err == nil {
+			return fd, nil
+		}
+		if resolver == nil || !errors.Is(err, asm.ErrUnsatisfiedProgramReference) {
+			return nil, err
+		}
+
+		before := len(spec.Instructions)
+		if rerr := resolveExterns(spec, resolver); rerr != nil {
+			return nil, fmt.Errorf("load program %q: %w", spec.Name, rerr)
+		}
+		if len(spec.Instructions) == before {
+			// The resolver didn't add anything new: retrying would just
+			// fail with the same unsatisfied reference forever.
+			return nil, err
+		}
+	}
+}
+
+// loadCollectionProgram loads a single Program belonging to a Collection
+// being created with opts. This is the call site that exercises
+// CollectionOptions.ExternResolver end to end, once flattenPrograms has
+// resolved whatever it could from the Collection's own ProgramSpecs.
+func loadCollectionProgram(spec *ProgramSpec, opts *CollectionOptions) (*sys.FD, error) {
+	var resolver ExternResolver
+	if opts != nil {
+		resolver = opts.ExternResolver
+	}
+	return loadProgram(spec, resolver)
+}
@@ -154,6 +154,131 @@ func TestSplitSymbols(t *testing.T) {
 	qt.Assert(t, qt.HasLen(m["sym4"], 4))
 }
 
+// testExternResolver adapts a plain func into an ExternResolver for
+// tests; ResolveExternVar always reports ErrExternNotFound since none of
+// these tests exercise extern variables.
+type testExternResolver struct {
+	resolveFunc func(name string, caller *ProgramSpec) (asm.Instructions, error)
+}
+
+func (r testExternResolver) ResolveExternFunc(name string, caller *ProgramSpec) (asm.Instructions, error) {
+	return r.resolveFunc(name, caller)
+}
+
+func (r testExternResolver) ResolveExternVar(name string, caller *ProgramSpec) (*btf.Var, error) {
+	return nil, ErrExternNotFound
+}
+
+func TestExternResolver(t *testing.T) {
+	spec := &ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.Call.Label("fwd"),
+			asm.Return(),
+		},
+		License: "MIT",
+	}
+
+	resolver := testExternResolver{
+		resolveFunc: func(name string, caller *ProgramSpec) (asm.Instructions, error) {
+			if name != "fwd" {
+				return nil, ErrExternNotFound
+			}
+			return asm.Instructions{
+				asm.Mov.Imm32(asm.R0, 42).WithSymbol("fwd"),
+				asm.Return(),
+			}, nil
+		},
+	}
+
+	fd, err := loadCollectionProgram(spec, &CollectionOptions{ExternResolver: resolver})
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, qt.IsNil(err))
+	defer fd.Close()
+}
+
+func TestExternResolverNotFound(t *testing.T) {
+	spec := &ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.Call.Label("fwd"),
+			asm.Return(),
+		},
+		License: "MIT",
+	}
+
+	resolver := testExternResolver{
+		resolveFunc: func(name string, caller *ProgramSpec) (asm.Instructions, error) {
+			return nil, ErrExternNotFound
+		},
+	}
+
+	_, err := loadCollectionProgram(spec, &CollectionOptions{ExternResolver: resolver})
+	if !errors.Is(err, asm.ErrUnsatisfiedProgramReference) {
+		t.Fatal("Expected an error wrapping ErrUnsatisfiedProgramReference, got:", err)
+	}
+}
+
+func TestExternResolverCycle(t *testing.T) {
+	spec := &ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.Call.Label("a"),
+			asm.Return(),
+		},
+		License: "MIT",
+	}
+
+	resolver := testExternResolver{
+		resolveFunc: func(name string, caller *ProgramSpec) (asm.Instructions, error) {
+			// Deliberately doesn't tag the replacement with its own
+			// Symbol, so the call back to itself is never marked
+			// "defined" and resolveExterns must recognise the repeat
+			// visit as a cycle instead of recursing forever.
+			return asm.Instructions{
+				asm.Call.Label(name),
+				asm.Return(),
+			}, nil
+		},
+	}
+
+	_, err := loadCollectionProgram(spec, &CollectionOptions{ExternResolver: resolver})
+	qt.Assert(t, qt.ErrorIs(err, ErrExternResolveCycle))
+}
+
+func TestExternResolverPreservesMetadata(t *testing.T) {
+	type marker struct{}
+
+	spec := &ProgramSpec{
+		Type: SocketFilter,
+		Instructions: asm.Instructions{
+			asm.Call.Label("fwd"),
+			asm.Return(),
+		},
+		License: "MIT",
+	}
+
+	tagged := asm.Mov.Imm32(asm.R0, 42).WithSymbol("fwd")
+	tagged.Metadata.Set(marker{}, "kept")
+
+	resolver := testExternResolver{
+		resolveFunc: func(name string, caller *ProgramSpec) (asm.Instructions, error) {
+			return asm.Instructions{tagged, asm.Return()}, nil
+		},
+	}
+
+	err := resolveExterns(spec, resolver)
+	qt.Assert(t, qt.IsNil(err))
+
+	for _, ins := range spec.Instructions {
+		if ins.Symbol() == "fwd" {
+			qt.Assert(t, qt.Equals(ins.Metadata.Get(marker{}), "kept"))
+			return
+		}
+	}
+	t.Fatal("linked-in subprog with symbol \"fwd\" not found in spec.Instructions")
+}
+
 func TestFlattenInstructionsAllocations(t *testing.T) {
 	name := "entrypoint"
 	instructions := asm.Instructions{
@@ -25,8 +25,43 @@ var (
 	sysErrKeyNotExist  = sys.Error(ErrKeyNotExist, unix.ENOENT)
 	sysErrKeyExist     = sys.Error(ErrKeyExist, unix.EEXIST)
 	sysErrNotSupported = sys.Error(ErrNotSupported, sys.ENOTSUPP)
+
+	sysErrPermission     = sys.Error(ErrPermission, unix.EPERM)
+	sysErrMapFull        = sys.Error(ErrMapFull, unix.ENOSPC)
+	sysErrMapBusy        = sys.Error(ErrMapBusy, unix.EBUSY)
+	sysErrLockFailed     = sys.Error(ErrLockFailed, unix.EAGAIN)
+	sysErrVerifierReject = sys.Error(ErrVerifierRejected, unix.EACCES)
+	sysErrDeviceNotReady = sys.Error(ErrDeviceNotReady, unix.ENODEV)
 )
 
+// ErrPermission is returned when a map or program syscall fails with
+// EPERM, typically because the caller is missing CAP_BPF / CAP_SYS_ADMIN,
+// or the kernel.unprivileged_bpf_disabled sysctl is set.
+var ErrPermission = errors.New("permission denied")
+
+// ErrMapFull is returned when updating a map fails with ENOSPC because
+// the map has reached its configured MaxEntries.
+var ErrMapFull = errors.New("map is full")
+
+// ErrMapBusy is returned when updating a map fails with EBUSY, typically
+// due to contention on a map that enforces exclusive access.
+var ErrMapBusy = errors.New("map is busy")
+
+// ErrLockFailed is returned when a map operation fails with EAGAIN due to
+// contention on a BPF spin lock.
+var ErrLockFailed = errors.New("failed to acquire lock")
+
+// ErrVerifierRejected is returned when the kernel verifier rejects a
+// program load with EACCES. The verifier log, if one was requested, is
+// included in the error string.
+var ErrVerifierRejected = errors.New("program rejected by verifier")
+
+// ErrDeviceNotReady is what wrapProgError returns for ENODEV, the errno
+// of, for example, an XDP or TC attachment to a network device that isn't
+// ready yet. Only progLoad passes its errors through wrapProgError, so
+// attach calls don't return it.
+var ErrDeviceNotReady = errors.New("device not ready")
+
 // sanitizeName replaces all invalid characters in name with replacement.
 // Passing a negative value for replacement will delete characters instead
 // of replacing them.
@@ -71,12 +106,24 @@ func progLoad(insns asm.Instructions, typ ProgramType, license string) (*sys.FD,
 	}
 	bytecode := buf.Bytes()
 
-	return sys.ProgLoad(&sys.ProgLoadAttr{
+	// Attach a verifier log buffer so that a rejected load comes back
+	// through wrapProgError with an actionable message instead of a bare
+	// EACCES.
+	logBuf := make([]byte, 64*1024)
+	fd, err := sys.ProgLoad(&sys.ProgLoadAttr{
 		ProgType: sys.ProgType(typ),
 		License:  sys.NewStringPointer(license),
 		Insns:    sys.SlicePointer(bytecode),
 		InsnCnt:  uint32(len(bytecode) / asm.InstructionSize),
+		LogLevel: 1,
+		LogSize:  uint32(len(logBuf)),
+		LogBuf:   sys.SlicePointer(logBuf),
 	})
+	if err != nil {
+		return nil, wrapProgError(err, strings.TrimRight(string(logBuf), "\x00"))
+	}
+
+	return fd, nil
 }
 
 var haveNestedMaps = internal.NewFeatureTest("nested maps", func() error {
@@ -190,6 +237,53 @@ func wrapMapError(err error) error {
 		return fmt.Errorf("key too big for map: %w", err)
 	}
 
+	if errors.Is(err, unix.EPERM) {
+		return sysErrPermission
+	}
+
+	if errors.Is(err, unix.ENOSPC) {
+		return sysErrMapFull
+	}
+
+	if errors.Is(err, unix.EBUSY) {
+		return sysErrMapBusy
+	}
+
+	if errors.Is(err, unix.EAGAIN) {
+		return sysErrLockFailed
+	}
+
+	return err
+}
+
+// wrapProgError translates raw syscall errors from program loads (progLoad)
+// into the typed errors exported by this package, the same way
+// wrapMapError does for maps. log is the verifier log collected for the
+// load, if one was requested; it's included on EACCES so a rejected
+// program still comes with an actionable message attached.
+//
+// The underlying errno always remains reachable via errors.Is / errors.As
+// against *unix.Errno, in addition to the category returned here.
+func wrapProgError(err error, log string) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, unix.EPERM) {
+		return sysErrPermission
+	}
+
+	if errors.Is(err, unix.ENODEV) {
+		return sysErrDeviceNotReady
+	}
+
+	if errors.Is(err, unix.EACCES) {
+		if log != "" {
+			return fmt.Errorf("%w: %s", sysErrVerifierReject, log)
+		}
+		return sysErrVerifierReject
+	}
+
 	return err
 }
 
@@ -369,3 +463,53 @@ var haveProgramExtInfos = internal.NewFeatureTest("program ext_infos", func() er
 
 	return err
 }, "5.0")
+
+// ProbeReport describes the outcome of a single kernel feature probe.
+type ProbeReport struct {
+	// Name is the human-readable description passed to NewFeatureTest.
+	Name string
+	// Err is the raw error the probe returned, or nil if the feature is
+	// supported.
+	Err error
+	// Errno is the raw syscall errno wrapped by Err, found with errors.As;
+	// wrapMapError and wrapProgError are not applied. It's the zero Errno
+	// if Err doesn't wrap a syscall error.
+	Errno unix.Errno
+}
+
+// ProbeAudit runs every kernel feature probe this package relies on and
+// reports which ones failed and why, so that a caller can tell "kernel
+// too old" apart from "missing CAP_BPF" instead of a single opaque
+// ErrNotSupported. Probes that turn every failure into ErrNotSupported,
+// such as "object names" or "prealloc maps", report a zero Errno, so for
+// them the two causes are not told apart.
+func ProbeAudit() []ProbeReport {
+	probes := []struct {
+		name string
+		fn   func() error
+	}{
+		{"nested maps", haveNestedMaps},
+		{"read- and write-only maps", haveMapMutabilityModifiers},
+		{"mmapable maps", haveMmapableMaps},
+		{"inner maps", haveInnerMaps},
+		{"prealloc maps", haveNoPreallocMaps},
+		{"object names", haveObjName},
+		{"dot in object names", objNameAllowsDot},
+		{"map batch api", haveBatchAPI},
+		{"bpf_probe_read_kernel", haveProbeReadKernel},
+		{"bpf2bpf calls", haveBPFToBPFCalls},
+		{"syscall wrapper", haveSyscallWrapper},
+		{"program ext_infos", haveProgramExtInfos},
+	}
+
+	reports := make([]ProbeReport, 0, len(probes))
+	for _, probe := range probes {
+		err := probe.fn()
+
+		var errno unix.Errno
+		errors.As(err, &errno)
+
+		reports = append(reports, ProbeReport{Name: probe.name, Err: err, Errno: errno})
+	}
+	return reports
+}
@@ -0,0 +1,77 @@
+package ebpf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/sys"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestWrapProgError(t *testing.T) {
+	qt.Assert(t, qt.IsNil(wrapProgError(nil, "")))
+
+	cases := []struct {
+		name  string
+		errno unix.Errno
+		want  error
+	}{
+		{"EPERM", unix.EPERM, ErrPermission},
+		{"ENODEV", unix.ENODEV, ErrDeviceNotReady},
+		{"EACCES", unix.EACCES, ErrVerifierRejected},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := sys.Error(errors.New("raw syscall error"), tc.errno)
+
+			got := wrapProgError(raw, "")
+			qt.Assert(t, qt.ErrorIs(got, tc.want))
+
+			var errno unix.Errno
+			qt.Assert(t, qt.IsTrue(errors.As(got, &errno)))
+			qt.Assert(t, qt.Equals(errno, tc.errno))
+		})
+	}
+}
+
+func TestWrapProgErrorIncludesLog(t *testing.T) {
+	raw := sys.Error(errors.New("raw syscall error"), unix.EACCES)
+
+	got := wrapProgError(raw, "R0 invalid mem access")
+	qt.Assert(t, qt.ErrorIs(got, ErrVerifierRejected))
+	if !strings.Contains(got.Error(), "R0 invalid mem access") {
+		t.Fatalf("expected verifier log in error, got: %v", got)
+	}
+}
+
+func TestWrapProgErrorPassesThroughUnrecognised(t *testing.T) {
+	raw := sys.Error(errors.New("raw syscall error"), unix.EINVAL)
+
+	got := wrapProgError(raw, "")
+	qt.Assert(t, qt.Equals(got, raw))
+}
+
+func TestProgLoadVerifierRejected(t *testing.T) {
+	insns := asm.Instructions{
+		// Dereferences R2, which is never initialised; the verifier must
+		// reject this.
+		asm.LoadMem(asm.R0, asm.R2, 0, asm.Word),
+		asm.Return(),
+	}
+
+	_, err := progLoad(insns, SocketFilter, "MIT")
+	testutils.SkipIfNotSupported(t, err)
+	if errors.Is(err, ErrPermission) {
+		t.Skip("insufficient privileges to reach the verifier")
+	}
+
+	if !errors.Is(err, ErrVerifierRejected) {
+		t.Fatal("Expected an error wrapping ErrVerifierRejected, got:", err)
+	}
+}